@@ -0,0 +1,226 @@
+// Package bdns implements the DNS resolution Boulder uses during challenge
+// and CAA validation: looking up A/TXT/CAA records through one or more
+// upstream resolvers, over plain UDP/TCP or DNS-over-HTTPS.
+package bdns
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/jmhodges/clock"
+	"github.com/miekg/dns"
+	"golang.org/x/net/context"
+
+	"github.com/letsencrypt/boulder/metrics"
+)
+
+// DNSResolver does the DNS lookups Boulder needs to perform domain control
+// validation and CAA checking. Implementations may talk to one resolver or
+// several, over UDP/TCP or DoH, and may enforce a quorum across multiple
+// upstreams.
+type DNSResolver interface {
+	LookupTXT(ctx context.Context, hostname string) (txts []string, err error)
+	LookupHost(ctx context.Context, hostname string) (addrs []string, err error)
+	LookupCAA(ctx context.Context, domain string) ([]*dns.CAA, error)
+}
+
+// ErrNXDOMAIN indicates a lookup's name does not exist, as distinct from a
+// transient failure (timeout, SERVFAIL, network error). Callers that need
+// to treat "definitively not found" differently from "couldn't tell" --
+// e.g. an RBL provider, where NXDOMAIN means "not listed" but a timeout
+// means "unknown" -- should check for it with IsNXDOMAIN rather than
+// treating every non-nil error the same way.
+var ErrNXDOMAIN = errors.New("bdns: NXDOMAIN")
+
+// IsNXDOMAIN reports whether err is bdns.ErrNXDOMAIN.
+func IsNXDOMAIN(err error) bool {
+	return err == ErrNXDOMAIN
+}
+
+// ReadHostList reads a file containing one hostname per line (blank lines
+// and lines starting with "#" are ignored) and returns the hostnames found.
+// It is used to load the CAASERVFAILExceptions list. An empty path returns
+// a nil list with no error.
+func ReadHostList(path string) ([]string, error) {
+	if path == "" {
+		return nil, nil
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var hosts []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		hosts = append(hosts, line)
+	}
+	return hosts, scanner.Err()
+}
+
+// DNSResolverImpl is a DNSResolver that queries a fixed set of recursive
+// resolvers over plain UDP, falling back to TCP on truncation.
+type DNSResolverImpl struct {
+	dnsClient              *dns.Client
+	servers                []string
+	allowLoopbackAddresses bool
+	caaSERVFAILExceptions  map[string]bool
+	stats                  metrics.Scope
+	clk                    clock.Clock
+	maxTries               int
+}
+
+// NewDNSResolverImpl constructs a DNSResolverImpl that queries servers in
+// round-robin order, making up to maxTries attempts in all and moving on to
+// the next server after any exchange error.
+func NewDNSResolverImpl(
+	readTimeout time.Duration,
+	servers []string,
+	caaSERVFAILExceptions []string,
+	stats metrics.Scope,
+	clk clock.Clock,
+	maxTries int,
+) *DNSResolverImpl {
+	return &DNSResolverImpl{
+		dnsClient:             &dns.Client{Timeout: readTimeout},
+		servers:               servers,
+		caaSERVFAILExceptions: hostListToSet(caaSERVFAILExceptions),
+		stats:                 stats,
+		clk:                   clk,
+		maxTries:              maxTries,
+	}
+}
+
+// NewTestDNSResolverImpl is like NewDNSResolverImpl, but permits resolving
+// against loopback addresses. It exists so integration tests can point the
+// VA at a local fake DNS server.
+func NewTestDNSResolverImpl(
+	readTimeout time.Duration,
+	servers []string,
+	stats metrics.Scope,
+	clk clock.Clock,
+	maxTries int,
+) *DNSResolverImpl {
+	r := NewDNSResolverImpl(readTimeout, servers, nil, stats, clk, maxTries)
+	r.allowLoopbackAddresses = true
+	return r
+}
+
+func hostListToSet(hosts []string) map[string]bool {
+	if len(hosts) == 0 {
+		return nil
+	}
+	set := make(map[string]bool, len(hosts))
+	for _, h := range hosts {
+		set[h] = true
+	}
+	return set
+}
+
+func (r *DNSResolverImpl) exchangeOne(ctx context.Context, m *dns.Msg) (*dns.Msg, error) {
+	if len(r.servers) == 0 {
+		return nil, fmt.Errorf("bdns: no servers configured")
+	}
+	var lastErr error
+	for i := 0; i < r.maxTries; i++ {
+		server := r.servers[i%len(r.servers)]
+		resp, _, err := r.dnsClient.ExchangeContext(ctx, m, server)
+		if err == nil && resp.Truncated {
+			tcpClient := &dns.Client{Net: "tcp", Timeout: r.dnsClient.Timeout}
+			resp, _, err = tcpClient.ExchangeContext(ctx, m, server)
+		}
+		if err == nil {
+			return resp, nil
+		}
+		lastErr = err
+	}
+	return nil, lastErr
+}
+
+// LookupTXT returns the strings of all TXT records for hostname.
+func (r *DNSResolverImpl) LookupTXT(ctx context.Context, hostname string) ([]string, error) {
+	m := new(dns.Msg)
+	m.SetQuestion(dns.Fqdn(hostname), dns.TypeTXT)
+	resp, err := r.exchangeOne(ctx, m)
+	if err != nil {
+		return nil, err
+	}
+	if resp.Rcode == dns.RcodeNameError {
+		return nil, ErrNXDOMAIN
+	}
+	if resp.Rcode != dns.RcodeSuccess {
+		return nil, fmt.Errorf("bdns: TXT lookup for %s returned %s", hostname, dns.RcodeToString[resp.Rcode])
+	}
+	var txts []string
+	for _, rr := range resp.Answer {
+		if txt, ok := rr.(*dns.TXT); ok {
+			txts = append(txts, strings.Join(txt.Txt, ""))
+		}
+	}
+	return txts, nil
+}
+
+// LookupHost returns the IPv4 (A record) addresses for hostname. AAAA
+// records are not looked up.
+func (r *DNSResolverImpl) LookupHost(ctx context.Context, hostname string) ([]string, error) {
+	m := new(dns.Msg)
+	m.SetQuestion(dns.Fqdn(hostname), dns.TypeA)
+	resp, err := r.exchangeOne(ctx, m)
+	if err != nil {
+		return nil, err
+	}
+	if resp.Rcode == dns.RcodeNameError {
+		return nil, ErrNXDOMAIN
+	}
+	if resp.Rcode != dns.RcodeSuccess {
+		return nil, fmt.Errorf("bdns: A lookup for %s returned %s", hostname, dns.RcodeToString[resp.Rcode])
+	}
+	var addrs []string
+	for _, rr := range resp.Answer {
+		if a, ok := rr.(*dns.A); ok {
+			if a.A.IsLoopback() && !r.allowLoopbackAddresses {
+				continue
+			}
+			addrs = append(addrs, a.A.String())
+		}
+	}
+	return addrs, nil
+}
+
+// LookupCAA returns the CAA records for domain.
+func (r *DNSResolverImpl) LookupCAA(ctx context.Context, domain string) ([]*dns.CAA, error) {
+	m := new(dns.Msg)
+	m.SetQuestion(dns.Fqdn(domain), dns.TypeCAA)
+	resp, err := r.exchangeOne(ctx, m)
+	if err != nil {
+		if r.caaSERVFAILExceptions[domain] {
+			return nil, nil
+		}
+		return nil, err
+	}
+	if resp.Rcode == dns.RcodeNameError {
+		return nil, ErrNXDOMAIN
+	}
+	if resp.Rcode != dns.RcodeSuccess {
+		if resp.Rcode == dns.RcodeServerFailure && r.caaSERVFAILExceptions[domain] {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("bdns: CAA lookup for %s returned %s", domain, dns.RcodeToString[resp.Rcode])
+	}
+	var caas []*dns.CAA
+	for _, rr := range resp.Answer {
+		if caa, ok := rr.(*dns.CAA); ok {
+			caas = append(caas, caa)
+		}
+	}
+	return caas, nil
+}
@@ -0,0 +1,219 @@
+package bdns
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"github.com/jmhodges/clock"
+	"github.com/miekg/dns"
+	"golang.org/x/net/context"
+
+	"github.com/letsencrypt/boulder/metrics"
+)
+
+// dohContentType is the media type RFC 8484 requires for both the POST body
+// and the Accept header of a DNS-over-HTTPS request.
+const dohContentType = "application/dns-message"
+
+// DoHResolverImpl is a DNSResolver that issues RFC 8484 DNS-over-HTTPS
+// queries against one or more upstream DoH endpoints instead of talking
+// UDP/TCP DNS directly. It is selected when Common.DNSResolver (or
+// Common.DNSResolvers) names an "https://" URL, which lets a VA run behind
+// an egress-restricted network that only permits outbound HTTPS.
+type DoHResolverImpl struct {
+	endpoints             []string
+	client                *http.Client
+	caaSERVFAILExceptions map[string]bool
+	stats                 metrics.Scope
+	clk                   clock.Clock
+	maxTries              int
+}
+
+// NewDoHResolverImpl constructs a DoHResolverImpl that POSTs wire-format DNS
+// messages to endpoints (round-robin), making up to maxTries attempts in all
+// and retrying only on 5xx responses or client timeouts. client supplies the timeout and TLS
+// configuration to use for every request.
+func NewDoHResolverImpl(
+	endpoints []string,
+	client *http.Client,
+	caaSERVFAILExceptions []string,
+	stats metrics.Scope,
+	clk clock.Clock,
+	maxTries int,
+) *DoHResolverImpl {
+	return &DoHResolverImpl{
+		endpoints:             endpoints,
+		client:                client,
+		caaSERVFAILExceptions: hostListToSet(caaSERVFAILExceptions),
+		stats:                 stats,
+		clk:                   clk,
+		maxTries:              maxTries,
+	}
+}
+
+// exchangeOne packs m into RFC 8484 wire format and POSTs it to the
+// configured endpoints in round-robin order, retrying on 5xx responses and
+// client timeouts until maxTries is exhausted.
+func (r *DoHResolverImpl) exchangeOne(ctx context.Context, m *dns.Msg) (*dns.Msg, error) {
+	if len(r.endpoints) == 0 {
+		return nil, fmt.Errorf("bdns: no DoH endpoints configured")
+	}
+	packed, err := m.Pack()
+	if err != nil {
+		return nil, err
+	}
+
+	var lastErr error
+	for i := 0; i < r.maxTries; i++ {
+		endpoint := r.endpoints[i%len(r.endpoints)]
+		start := r.clk.Now()
+		resp, err := r.post(ctx, endpoint, packed)
+		r.stats.TimingDuration("DoH.Latency", r.clk.Since(start))
+		if err == nil {
+			return resp, nil
+		}
+		lastErr = err
+		if !isRetryable(err) {
+			break
+		}
+		r.stats.Inc("DoH.Retries", 1)
+	}
+	return nil, lastErr
+}
+
+// post issues a single DoH POST to endpoint and unpacks the response. It
+// returns a retryable error for 5xx status codes and for the underlying
+// HTTP client reporting a timeout.
+func (r *DoHResolverImpl) post(ctx context.Context, endpoint string, packed []byte) (*dns.Msg, error) {
+	req, err := http.NewRequest("POST", endpoint, bytes.NewReader(packed))
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", dohContentType)
+	req.Header.Set("Accept", dohContentType)
+
+	httpResp, err := r.client.Do(req)
+	if err != nil {
+		if isTimeout(err) {
+			return nil, retryableError{err}
+		}
+		return nil, err
+	}
+	defer httpResp.Body.Close()
+
+	if httpResp.StatusCode >= 500 {
+		return nil, retryableError{fmt.Errorf("DoH endpoint %s returned %s", endpoint, httpResp.Status)}
+	}
+	if httpResp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("DoH endpoint %s returned %s", endpoint, httpResp.Status)
+	}
+
+	body, err := ioutil.ReadAll(httpResp.Body)
+	if err != nil {
+		return nil, err
+	}
+	respMsg := new(dns.Msg)
+	if err := respMsg.Unpack(body); err != nil {
+		return nil, fmt.Errorf("unpacking DoH response from %s: %s", endpoint, err)
+	}
+	return respMsg, nil
+}
+
+// retryableError marks an error as eligible for another attempt against the
+// next configured endpoint.
+type retryableError struct{ error }
+
+func isRetryable(err error) bool {
+	_, ok := err.(retryableError)
+	return ok
+}
+
+func isTimeout(err error) bool {
+	type timeouter interface{ Timeout() bool }
+	if t, ok := err.(timeouter); ok {
+		return t.Timeout()
+	}
+	return strings.Contains(err.Error(), "timeout")
+}
+
+// LookupTXT returns the strings of all TXT records for hostname, queried
+// over DoH.
+func (r *DoHResolverImpl) LookupTXT(ctx context.Context, hostname string) ([]string, error) {
+	m := new(dns.Msg)
+	m.SetQuestion(dns.Fqdn(hostname), dns.TypeTXT)
+	resp, err := r.exchangeOne(ctx, m)
+	if err != nil {
+		return nil, err
+	}
+	if resp.Rcode == dns.RcodeNameError {
+		return nil, ErrNXDOMAIN
+	}
+	if resp.Rcode != dns.RcodeSuccess {
+		return nil, fmt.Errorf("bdns: TXT lookup for %s returned %s", hostname, dns.RcodeToString[resp.Rcode])
+	}
+	var txts []string
+	for _, rr := range resp.Answer {
+		if txt, ok := rr.(*dns.TXT); ok {
+			txts = append(txts, strings.Join(txt.Txt, ""))
+		}
+	}
+	return txts, nil
+}
+
+// LookupHost returns the IPv4 (A record) addresses for hostname, queried
+// over DoH. AAAA records are not looked up.
+func (r *DoHResolverImpl) LookupHost(ctx context.Context, hostname string) ([]string, error) {
+	m := new(dns.Msg)
+	m.SetQuestion(dns.Fqdn(hostname), dns.TypeA)
+	resp, err := r.exchangeOne(ctx, m)
+	if err != nil {
+		return nil, err
+	}
+	if resp.Rcode == dns.RcodeNameError {
+		return nil, ErrNXDOMAIN
+	}
+	if resp.Rcode != dns.RcodeSuccess {
+		return nil, fmt.Errorf("bdns: A lookup for %s returned %s", hostname, dns.RcodeToString[resp.Rcode])
+	}
+	var addrs []string
+	for _, rr := range resp.Answer {
+		if a, ok := rr.(*dns.A); ok {
+			addrs = append(addrs, a.A.String())
+		}
+	}
+	return addrs, nil
+}
+
+// LookupCAA returns the CAA records for domain, queried over DoH.
+func (r *DoHResolverImpl) LookupCAA(ctx context.Context, domain string) ([]*dns.CAA, error) {
+	m := new(dns.Msg)
+	m.SetQuestion(dns.Fqdn(domain), dns.TypeCAA)
+	resp, err := r.exchangeOne(ctx, m)
+	if err != nil {
+		if r.caaSERVFAILExceptions[domain] {
+			return nil, nil
+		}
+		return nil, err
+	}
+	if resp.Rcode == dns.RcodeNameError {
+		return nil, ErrNXDOMAIN
+	}
+	if resp.Rcode != dns.RcodeSuccess {
+		if resp.Rcode == dns.RcodeServerFailure && r.caaSERVFAILExceptions[domain] {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("bdns: CAA lookup for %s returned %s", domain, dns.RcodeToString[resp.Rcode])
+	}
+	var caas []*dns.CAA
+	for _, rr := range resp.Answer {
+		if caa, ok := rr.(*dns.CAA); ok {
+			caas = append(caas, caa)
+		}
+	}
+	return caas, nil
+}
+
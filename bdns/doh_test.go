@@ -0,0 +1,116 @@
+package bdns
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/jmhodges/clock"
+	"github.com/miekg/dns"
+	"golang.org/x/net/context"
+)
+
+func packResponse(t *testing.T, addr string) []byte {
+	t.Helper()
+	resp := new(dns.Msg)
+	resp.Answer = append(resp.Answer, &dns.A{
+		Hdr: dns.RR_Header{Name: "example.com.", Rrtype: dns.TypeA, Class: dns.ClassINET},
+		A:   net.ParseIP(addr),
+	})
+	packed, err := resp.Pack()
+	if err != nil {
+		t.Fatalf("packing test response: %s", err)
+	}
+	return packed
+}
+
+func TestDoHResolverImplHappyPath(t *testing.T) {
+	var gotAccept, gotContentType string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotAccept = r.Header.Get("Accept")
+		gotContentType = r.Header.Get("Content-Type")
+		r.Body.Close()
+		w.Header().Set("Content-Type", dohContentType)
+		w.Write(packResponse(t, "1.2.3.4"))
+	}))
+	defer srv.Close()
+
+	r := NewDoHResolverImpl([]string{srv.URL}, srv.Client(), nil, testScope{}, clock.NewFake(), 3)
+	addrs, err := r.LookupHost(context.Background(), "example.com")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(addrs) != 1 || addrs[0] != "1.2.3.4" {
+		t.Fatalf("got %v, want [1.2.3.4]", addrs)
+	}
+	if gotAccept != dohContentType || gotContentType != dohContentType {
+		t.Fatalf("got Accept=%q Content-Type=%q, want both %q", gotAccept, gotContentType, dohContentType)
+	}
+}
+
+func TestDoHResolverImplRetriesOn5xx(t *testing.T) {
+	var calls int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&calls, 1)
+		r.Body.Close()
+		if n < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Header().Set("Content-Type", dohContentType)
+		w.Write(packResponse(t, "5.6.7.8"))
+	}))
+	defer srv.Close()
+
+	r := NewDoHResolverImpl([]string{srv.URL}, srv.Client(), nil, testScope{}, clock.NewFake(), 3)
+	addrs, err := r.LookupHost(context.Background(), "example.com")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(addrs) != 1 || addrs[0] != "5.6.7.8" {
+		t.Fatalf("got %v, want [5.6.7.8]", addrs)
+	}
+	if calls != 3 {
+		t.Fatalf("got %d calls, want exactly 3 (2 failures + 1 success)", calls)
+	}
+}
+
+func TestDoHResolverImplGivesUpAfterMaxTries(t *testing.T) {
+	var calls int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		r.Body.Close()
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	r := NewDoHResolverImpl([]string{srv.URL}, srv.Client(), nil, testScope{}, clock.NewFake(), 3)
+	_, err := r.LookupHost(context.Background(), "example.com")
+	if err == nil {
+		t.Fatal("expected an error after exhausting retries, got nil")
+	}
+	if calls != 3 {
+		t.Fatalf("got %d calls, want exactly 3 (maxTries)", calls)
+	}
+}
+
+func TestDoHResolverImplDoesNotRetryOn4xx(t *testing.T) {
+	var calls int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		r.Body.Close()
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer srv.Close()
+
+	r := NewDoHResolverImpl([]string{srv.URL}, srv.Client(), nil, testScope{}, clock.NewFake(), 3)
+	_, err := r.LookupHost(context.Background(), "example.com")
+	if err == nil {
+		t.Fatal("expected an error, got nil")
+	}
+	if calls != 1 {
+		t.Fatalf("got %d calls, want exactly 1 (4xx is not retryable)", calls)
+	}
+}
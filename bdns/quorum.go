@@ -0,0 +1,195 @@
+package bdns
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/miekg/dns"
+	"golang.org/x/net/context"
+
+	"github.com/letsencrypt/boulder/metrics"
+)
+
+// QuorumResolver is a DNSResolver that fans every lookup out to a set of
+// independent upstream resolvers in parallel and only succeeds once at
+// least quorum of them return identical results. It defends against a
+// single poisoned or compromised recursive resolver being trusted during
+// ACME validation, in the same spirit as the CAA distributed resolver (see
+// the cdr package) but generalized to every lookup type.
+//
+// Each upstream's failures are counted independently (mirroring
+// the per-proxy failure accounting the cdr package uses for CAA checks), and
+// an upstream that fails is simply excluded from that lookup's quorum rather
+// than failing the whole lookup outright.
+type QuorumResolver struct {
+	resolvers []DNSResolver
+	addrs     []string
+	quorum    int
+	stats     metrics.Scope
+
+	mu       sync.Mutex
+	failures []int64
+}
+
+// NewQuorumResolver wraps resolvers (one independent DNSResolver per
+// upstream, in the same order as addrs) so that every lookup is sent to all
+// of them in parallel and only succeeds if at least quorum agree on an
+// identical result set.
+func NewQuorumResolver(resolvers []DNSResolver, addrs []string, quorum int, stats metrics.Scope) *QuorumResolver {
+	return &QuorumResolver{
+		resolvers: resolvers,
+		addrs:     addrs,
+		quorum:    quorum,
+		stats:     stats,
+		failures:  make([]int64, len(resolvers)),
+	}
+}
+
+func (q *QuorumResolver) recordResult(i int, err error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if err != nil {
+		q.failures[i]++
+		q.stats.Inc(fmt.Sprintf("Quorum.Failures.%s", q.addrs[i]), 1)
+	}
+}
+
+// quorumResult is one resolver's answer to a fanned-out lookup: key is a
+// comparable (sorted, stringified) form of its answer for agreement
+// checking, and value is the original answer to return once a key wins
+// quorum. Both are only meaningful when err is nil. It is written exactly
+// once, at index i, by the goroutine that queried resolvers[i] -- never
+// appended to a shared slice -- so results stay in resolver-index order
+// regardless of which upstream answers first.
+type quorumResult struct {
+	key   string
+	value interface{}
+	err   error
+}
+
+// fanOut runs lookup against every configured resolver in parallel and
+// returns one quorumResult per resolver, at that resolver's index.
+func (q *QuorumResolver) fanOut(lookup func(r DNSResolver) (key string, value interface{}, err error)) []quorumResult {
+	results := make([]quorumResult, len(q.resolvers))
+	var wg sync.WaitGroup
+	for i, r := range q.resolvers {
+		wg.Add(1)
+		go func(i int, r DNSResolver) {
+			defer wg.Done()
+			key, value, err := lookup(r)
+			q.recordResult(i, err)
+			results[i] = quorumResult{key: key, value: value, err: err}
+		}(i, r)
+	}
+	wg.Wait()
+	return results
+}
+
+// quorumKey tallies how many non-error results share each key and returns
+// the one key that reaches at least q.quorum votes. It fails both when no
+// key reaches quorum (not enough agreement) and when more than one key
+// reaches quorum (a genuine split, e.g. 2-of-4 vs 2-of-4 with quorum=2) --
+// the latter must not be resolved by picking whichever key a racing
+// goroutine happened to record first.
+func (q *QuorumResolver) quorumKey(results []quorumResult) (string, error) {
+	counts := make(map[string]int, len(results))
+	for _, r := range results {
+		if r.err != nil {
+			continue
+		}
+		counts[r.key]++
+	}
+
+	var winners []string
+	for key, count := range counts {
+		if count >= q.quorum {
+			winners = append(winners, key)
+		}
+	}
+	sort.Strings(winners) // deterministic ordering for the error message only
+
+	switch len(winners) {
+	case 0:
+		return "", fmt.Errorf("bdns: no %d of %d resolvers agreed on an answer (quorum %d)", q.quorum, len(results), q.quorum)
+	case 1:
+		return winners[0], nil
+	default:
+		return "", fmt.Errorf("bdns: resolvers split %d ways, each reaching quorum %d independently -- refusing to pick one", len(winners), q.quorum)
+	}
+}
+
+// LookupTXT returns the TXT strings agreed upon by at least quorum of the
+// configured resolvers.
+func (q *QuorumResolver) LookupTXT(ctx context.Context, hostname string) ([]string, error) {
+	results := q.fanOut(func(r DNSResolver) (string, interface{}, error) {
+		txts, err := r.LookupTXT(ctx, hostname)
+		if err != nil {
+			return "", nil, err
+		}
+		sorted := append([]string(nil), txts...)
+		sort.Strings(sorted)
+		return fmt.Sprint(sorted), txts, nil
+	})
+	key, err := q.quorumKey(results)
+	if err != nil {
+		return nil, err
+	}
+	for _, r := range results {
+		if r.err == nil && r.key == key {
+			return r.value.([]string), nil
+		}
+	}
+	return nil, fmt.Errorf("bdns: quorum reached but no matching answer found")
+}
+
+// LookupHost returns the addresses agreed upon by at least quorum of the
+// configured resolvers.
+func (q *QuorumResolver) LookupHost(ctx context.Context, hostname string) ([]string, error) {
+	results := q.fanOut(func(r DNSResolver) (string, interface{}, error) {
+		addrs, err := r.LookupHost(ctx, hostname)
+		if err != nil {
+			return "", nil, err
+		}
+		sorted := append([]string(nil), addrs...)
+		sort.Strings(sorted)
+		return fmt.Sprint(sorted), addrs, nil
+	})
+	key, err := q.quorumKey(results)
+	if err != nil {
+		return nil, err
+	}
+	for _, r := range results {
+		if r.err == nil && r.key == key {
+			return r.value.([]string), nil
+		}
+	}
+	return nil, fmt.Errorf("bdns: quorum reached but no matching answer found")
+}
+
+// LookupCAA returns the CAA records agreed upon by at least quorum of the
+// configured resolvers.
+func (q *QuorumResolver) LookupCAA(ctx context.Context, domain string) ([]*dns.CAA, error) {
+	results := q.fanOut(func(r DNSResolver) (string, interface{}, error) {
+		caas, err := r.LookupCAA(ctx, domain)
+		if err != nil {
+			return "", nil, err
+		}
+		strs := make([]string, len(caas))
+		for i, c := range caas {
+			strs[i] = c.String()
+		}
+		sort.Strings(strs)
+		return fmt.Sprint(strs), caas, nil
+	})
+	key, err := q.quorumKey(results)
+	if err != nil {
+		return nil, err
+	}
+	for _, r := range results {
+		if r.err == nil && r.key == key {
+			return r.value.([]*dns.CAA), nil
+		}
+	}
+	return nil, fmt.Errorf("bdns: quorum reached but no matching answer found")
+}
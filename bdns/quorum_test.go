@@ -0,0 +1,143 @@
+package bdns
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+	"golang.org/x/net/context"
+)
+
+type testScope struct{}
+
+func (testScope) Inc(stat string, delta int64)                {}
+func (testScope) GaugeValue(stat string, value int64)          {}
+func (testScope) TimingDuration(stat string, d time.Duration)  {}
+
+// fakeResolver is a DNSResolver whose LookupHost answer, error, and
+// artificial delay are all configurable, so tests can control which
+// resolver in a QuorumResolver "finishes first".
+type fakeResolver struct {
+	addrs []string
+	err   error
+	delay time.Duration
+}
+
+func (f *fakeResolver) LookupTXT(ctx context.Context, hostname string) ([]string, error) {
+	return nil, fmt.Errorf("not implemented")
+}
+
+func (f *fakeResolver) LookupHost(ctx context.Context, hostname string) ([]string, error) {
+	if f.delay > 0 {
+		time.Sleep(f.delay)
+	}
+	if f.err != nil {
+		return nil, f.err
+	}
+	return f.addrs, nil
+}
+
+func (f *fakeResolver) LookupCAA(ctx context.Context, domain string) ([]*dns.CAA, error) {
+	return nil, fmt.Errorf("not implemented")
+}
+
+func TestQuorumResolverHappyPath(t *testing.T) {
+	resolvers := []DNSResolver{
+		&fakeResolver{addrs: []string{"1.2.3.4"}},
+		&fakeResolver{addrs: []string{"1.2.3.4"}},
+		&fakeResolver{addrs: []string{"1.2.3.4"}},
+	}
+	addrs := []string{"r0", "r1", "r2"}
+	q := NewQuorumResolver(resolvers, addrs, 2, testScope{})
+
+	got, err := q.LookupHost(context.Background(), "example.com")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(got) != 1 || got[0] != "1.2.3.4" {
+		t.Fatalf("got %v, want [1.2.3.4]", got)
+	}
+}
+
+// TestQuorumResolverReturnsWinningAnswerRegardlessOfCompletionOrder pins
+// down the bug where a non-winning resolver's answer could be
+// returned just because its goroutine happened to finish first: R0 is
+// "poisoned" (returns a different address) and answers quickest, while R1
+// and R2 agree on the real address but answer slower and out of index
+// order. The quorum is 2-of-3, so the result must be R1/R2's address, never
+// R0's, no matter which goroutine finishes first.
+func TestQuorumResolverReturnsWinningAnswerRegardlessOfCompletionOrder(t *testing.T) {
+	resolvers := []DNSResolver{
+		&fakeResolver{addrs: []string{"6.6.6.6"}, delay: 0},                 // R0: poisoned, fastest
+		&fakeResolver{addrs: []string{"1.2.3.4"}, delay: 20 * time.Millisecond}, // R1: correct, slowest
+		&fakeResolver{addrs: []string{"1.2.3.4"}, delay: 10 * time.Millisecond}, // R2: correct, finishes before R1
+	}
+	addrs := []string{"r0", "r1", "r2"}
+	q := NewQuorumResolver(resolvers, addrs, 2, testScope{})
+
+	for i := 0; i < 20; i++ {
+		got, err := q.LookupHost(context.Background(), "example.com")
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if len(got) != 1 || got[0] != "1.2.3.4" {
+			t.Fatalf("got %v, want [1.2.3.4] (the quorum-winning answer, not the poisoned R0 answer)", got)
+		}
+	}
+}
+
+func TestQuorumResolverFailsOnInsufficientAgreement(t *testing.T) {
+	resolvers := []DNSResolver{
+		&fakeResolver{addrs: []string{"1.1.1.1"}},
+		&fakeResolver{addrs: []string{"2.2.2.2"}},
+		&fakeResolver{addrs: []string{"3.3.3.3"}},
+	}
+	addrs := []string{"r0", "r1", "r2"}
+	q := NewQuorumResolver(resolvers, addrs, 2, testScope{})
+
+	_, err := q.LookupHost(context.Background(), "example.com")
+	if err == nil {
+		t.Fatal("expected an error when no two resolvers agree, got nil")
+	}
+}
+
+// TestQuorumResolverFailsOnSplitDisagreement covers a genuine split: two
+// different pairs each independently reach the configured quorum (2-of-4
+// agreeing with another, different, 2-of-4). That must be treated as
+// disagreement, not resolved by picking one side non-deterministically.
+func TestQuorumResolverFailsOnSplitDisagreement(t *testing.T) {
+	resolvers := []DNSResolver{
+		&fakeResolver{addrs: []string{"1.1.1.1"}},
+		&fakeResolver{addrs: []string{"1.1.1.1"}},
+		&fakeResolver{addrs: []string{"2.2.2.2"}},
+		&fakeResolver{addrs: []string{"2.2.2.2"}},
+	}
+	addrs := []string{"r0", "r1", "r2", "r3"}
+	q := NewQuorumResolver(resolvers, addrs, 2, testScope{})
+
+	for i := 0; i < 20; i++ {
+		_, err := q.LookupHost(context.Background(), "example.com")
+		if err == nil {
+			t.Fatal("expected an error on a 2-vs-2 split, got nil")
+		}
+	}
+}
+
+func TestQuorumResolverToleratesResolverFailures(t *testing.T) {
+	resolvers := []DNSResolver{
+		&fakeResolver{err: fmt.Errorf("timeout")},
+		&fakeResolver{addrs: []string{"1.2.3.4"}},
+		&fakeResolver{addrs: []string{"1.2.3.4"}},
+	}
+	addrs := []string{"r0", "r1", "r2"}
+	q := NewQuorumResolver(resolvers, addrs, 2, testScope{})
+
+	got, err := q.LookupHost(context.Background(), "example.com")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(got) != 1 || got[0] != "1.2.3.4" {
+		t.Fatalf("got %v, want [1.2.3.4]", got)
+	}
+}
@@ -1,12 +1,26 @@
 package main
 
 import (
+	"errors"
 	"flag"
+	"fmt"
+	"net/http"
 	"os"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/grpc-ecosystem/go-grpc-prometheus"
 	"github.com/jmhodges/clock"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
 
 	"github.com/letsencrypt/boulder/bdns"
 	"github.com/letsencrypt/boulder/cdr"
@@ -18,6 +32,12 @@ import (
 
 const clientName = "VA"
 
+// healthServiceMethodPrefix identifies RPCs belonging to the standard gRPC
+// health service, which the drain interceptor always lets through so its
+// Serving/NotServing status (not a drain-triggered Unavailable) is what
+// health-checking clients see.
+const healthServiceMethodPrefix = "/grpc.health.v1.Health/"
+
 type config struct {
 	VA struct {
 		cmd.ServiceConfig
@@ -30,6 +50,13 @@ type config struct {
 
 		GoogleSafeBrowsing *cmd.GoogleSafeBrowsingConfig
 
+		// DomainReputation configures the set of domain-reputation/blocklist
+		// providers consulted before issuance. If unset, and GoogleSafeBrowsing
+		// is configured, the legacy Google Safe Browsing-only behavior is used.
+		// Providers are composed with an OR policy: a name is blocked if any
+		// configured provider blocks it.
+		DomainReputation *cmd.DomainReputationConfig
+
 		CAADistributedResolver *cmd.CAADistributedResolverConfig
 
 		// The number of times to try a DNS query (that has a temporary error)
@@ -43,6 +70,15 @@ type config struct {
 		RemoteVAs                   []cmd.GRPCClientConfig
 		MaxRemoteValidationFailures int64
 
+		// ShutdownStopTimeout is how long to wait after marking the gRPC
+		// health service NotServing before beginning GracefulStop, giving
+		// the RA time to notice and stop sending new RPCs.
+		ShutdownStopTimeout cmd.ConfigDuration
+		// ShutdownKillTimeout bounds GracefulStop; if in-flight
+		// PerformValidation RPCs haven't drained by this deadline, the
+		// listener is force-closed.
+		ShutdownKillTimeout cmd.ConfigDuration
+
 		Features map[string]bool
 	}
 
@@ -52,6 +88,21 @@ type config struct {
 		DNSResolver               string
 		DNSTimeout                string
 		DNSAllowLoopbackAddresses bool
+
+		// DNSResolverHTTPSTLS configures the TLS client used when DNSResolver
+		// is a "https://" URL, causing lookups to be issued as DNS-over-HTTPS
+		// (RFC 8484) POSTs instead of plain UDP/TCP DNS.
+		DNSResolverHTTPSTLS *cmd.TLSConfig
+
+		// DNSResolvers, if non-empty, is used instead of DNSResolver. When
+		// DNSQuorum is greater than zero, every challenge/CAA lookup is sent
+		// to all of the listed resolvers in parallel, and DNSQuorum of the
+		// responses must agree before a lookup is considered successful; a
+		// disagreement beyond that threshold fails the validation. When
+		// DNSQuorum is zero, the listed resolvers are queried one at a time
+		// in round-robin order.
+		DNSResolvers []string
+		DNSQuorum    int
 	}
 }
 
@@ -89,17 +140,6 @@ func main() {
 		pc.TLSPort = c.VA.PortConfig.TLSPort
 	}
 
-	var sbc va.SafeBrowsing
-	// If the feature flag is set, use the Google safebrowsing library that
-	// implements the v4 api instead of the legacy letsencrypt fork of
-	// go-safebrowsing-api
-	if features.Enabled(features.GoogleSafeBrowsingV4) {
-		sbc, err = newGoogleSafeBrowsingV4(c.VA.GoogleSafeBrowsing, logger)
-	} else {
-		sbc, err = newGoogleSafeBrowsing(c.VA.GoogleSafeBrowsing)
-	}
-	cmd.FailOnError(err, "Failed to create Google Safe Browsing client")
-
 	var cdrClient *cdr.CAADistributedResolver
 	if c.VA.CAADistributedResolver != nil {
 		var err error
@@ -121,27 +161,126 @@ func main() {
 	clk := clock.Default()
 	caaSERVFAILExceptions, err := bdns.ReadHostList(c.VA.CAASERVFAILExceptions)
 	cmd.FailOnError(err, "Couldn't read CAASERVFAILExceptions file")
+	resolverAddrs := c.Common.DNSResolvers
+	if len(resolverAddrs) == 0 {
+		resolverAddrs = []string{c.Common.DNSResolver}
+	}
+
+	newResolverFor := func(addrs []string) bdns.DNSResolver {
+		if strings.HasPrefix(addrs[0], "https://") {
+			httpClient := &http.Client{
+				Timeout: dnsTimeout,
+			}
+			if c.Common.DNSResolverHTTPSTLS != nil {
+				tlsConfig, err := c.Common.DNSResolverHTTPSTLS.Load()
+				cmd.FailOnError(err, "TLS config for DoH resolver")
+				httpClient.Transport = &http.Transport{
+					TLSClientConfig: tlsConfig,
+				}
+			}
+			return bdns.NewDoHResolverImpl(
+				addrs,
+				httpClient,
+				caaSERVFAILExceptions,
+				scope,
+				clk,
+				dnsTries)
+		} else if !c.Common.DNSAllowLoopbackAddresses {
+			return bdns.NewDNSResolverImpl(
+				dnsTimeout,
+				addrs,
+				caaSERVFAILExceptions,
+				scope,
+				clk,
+				dnsTries)
+		}
+		return bdns.NewTestDNSResolverImpl(dnsTimeout, addrs, scope, clk, dnsTries)
+	}
+
 	var resolver bdns.DNSResolver
-	if !c.Common.DNSAllowLoopbackAddresses {
-		r := bdns.NewDNSResolverImpl(
-			dnsTimeout,
-			[]string{c.Common.DNSResolver},
-			caaSERVFAILExceptions,
-			scope,
-			clk,
-			dnsTries)
-		resolver = r
+	if c.Common.DNSQuorum > 0 {
+		if c.Common.DNSQuorum > len(resolverAddrs) {
+			cmd.FailOnError(errors.New("DNSQuorum cannot exceed the number of configured DNSResolvers"), "Invalid DNS quorum configuration")
+		}
+		// Build one independent resolver per upstream so QuorumResolver can
+		// fan each lookup out to all of them in parallel and compare results,
+		// rather than having a single resolver round-robin between upstreams.
+		resolvers := make([]bdns.DNSResolver, len(resolverAddrs))
+		for i, addr := range resolverAddrs {
+			resolvers[i] = newResolverFor([]string{addr})
+		}
+		resolver = bdns.NewQuorumResolver(resolvers, resolverAddrs, c.Common.DNSQuorum, scope)
+	} else {
+		resolver = newResolverFor(resolverAddrs)
+	}
+
+	var reputationProviders []va.DomainReputation
+	if c.VA.DomainReputation != nil {
+		for _, p := range c.VA.DomainReputation.Providers {
+			var provider va.DomainReputation
+			switch p {
+			case "google_v4":
+				provider, err = newGoogleSafeBrowsingV4(c.VA.GoogleSafeBrowsing, logger)
+			case "google_v3":
+				provider, err = newGoogleSafeBrowsing(c.VA.GoogleSafeBrowsing)
+			case "static_blocklist":
+				provider, err = va.NewStaticBlocklistReputation(c.VA.DomainReputation.StaticBlocklist.Path, logger)
+			case "dns_rbl":
+				provider, err = va.NewDNSRBLReputation(resolver, c.VA.DomainReputation.DNSRBL.Zone, scope)
+			case "http_api":
+				provider, err = va.NewHTTPAPIReputation(c.VA.DomainReputation.HTTPAPI.URL, c.VA.DomainReputation.HTTPAPI.Timeout.Duration, scope)
+			default:
+				err = fmt.Errorf("unrecognized VA.DomainReputation.Providers entry %q", p)
+			}
+			cmd.FailOnError(err, "Failed to create domain reputation provider")
+			reputationProviders = append(reputationProviders, provider)
+		}
+	} else if features.Enabled(features.GoogleSafeBrowsingV4) {
+		// If the feature flag is set, use the Google safebrowsing library that
+		// implements the v4 api instead of the legacy letsencrypt fork of
+		// go-safebrowsing-api
+		sbc, err := newGoogleSafeBrowsingV4(c.VA.GoogleSafeBrowsing, logger)
+		cmd.FailOnError(err, "Failed to create Google Safe Browsing client")
+		reputationProviders = append(reputationProviders, sbc)
 	} else {
-		r := bdns.NewTestDNSResolverImpl(dnsTimeout, []string{c.Common.DNSResolver}, scope, clk, dnsTries)
-		resolver = r
+		sbc, err := newGoogleSafeBrowsing(c.VA.GoogleSafeBrowsing)
+		cmd.FailOnError(err, "Failed to create Google Safe Browsing client")
+		reputationProviders = append(reputationProviders, sbc)
 	}
+	sbc := va.NewMultiDomainReputation(reputationProviders, scope)
+
+	promRegistry := prometheus.NewRegistry()
+	promRegistry.MustRegister(prometheus.NewGoCollector())
+	promRegistry.MustRegister(prometheus.NewProcessCollector(prometheus.ProcessCollectorOpts{}))
+
+	grpcServerMetrics := grpc_prometheus.NewServerMetrics()
+	grpcServerMetrics.EnableHandlingTimeHistogram()
+	promRegistry.MustRegister(grpcServerMetrics)
+
+	grpcClientMetrics := grpc_prometheus.NewClientMetrics()
+	grpcClientMetrics.EnableClientHandlingTimeHistogram()
+	promRegistry.MustRegister(grpcClientMetrics)
+
+	validationLatency := prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name: "va_validation_latency_seconds",
+		Help: "Time taken to perform a challenge validation, labeled by challenge type and result",
+	}, []string{"type", "result"})
+	promRegistry.MustRegister(validationLatency)
+
+	caaLatency := prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name: "va_caa_check_latency_seconds",
+		Help: "Time taken to perform a CAA lookup",
+	}, []string{"result"})
+	promRegistry.MustRegister(caaLatency)
+
+	http.Handle("/metrics", promhttp.HandlerFor(promRegistry, promhttp.HandlerOpts{}))
 
 	var remotes []va.RemoteVA
 	if len(c.VA.RemoteVAs) > 0 {
 		tls, err := c.VA.TLS.Load()
 		cmd.FailOnError(err, "TLS config")
 		for _, rva := range c.VA.RemoteVAs {
-			vaConn, err := bgrpc.ClientSetup(&rva, tls, scope)
+			vaConn, err := bgrpc.ClientSetup(&rva, tls, scope, grpcClientMetrics.UnaryClientInterceptor())
 			cmd.FailOnError(err, "Unable to create remote VA client")
 			remotes = append(remotes, va.RemoteVA{bgrpc.NewValidationAuthorityGRPCClient(vaConn), strings.Join(rva.ServerAddresses, ",")})
 		}
@@ -158,22 +297,75 @@ func main() {
 		c.VA.IssuerDomain,
 		scope,
 		clk,
-		logger)
+		logger,
+		validationLatency,
+		caaLatency)
+
+	var inFlight sync.WaitGroup
+	var draining int32
+	drainInterceptor := func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		// Let the health service's own Check RPC through regardless of
+		// draining: its NOT_SERVING/SERVING status is the intended signal to
+		// health-checking clients, and gating it here would instead surface
+		// a transport-level Unavailable before the status toggle even has a
+		// chance to answer.
+		if strings.HasPrefix(info.FullMethod, healthServiceMethodPrefix) {
+			return handler(ctx, req)
+		}
+		if atomic.LoadInt32(&draining) != 0 {
+			return nil, status.Error(codes.Unavailable, "VA is shutting down")
+		}
+		inFlight.Add(1)
+		defer inFlight.Done()
+		return handler(ctx, req)
+	}
 
 	tls, err := c.VA.TLS.Load()
 	cmd.FailOnError(err, "TLS config")
-	grpcSrv, l, err := bgrpc.NewServer(c.VA.GRPC, tls, scope)
+	grpcSrv, l, err := bgrpc.NewServer(c.VA.GRPC, tls, scope, grpcServerMetrics.UnaryServerInterceptor(), drainInterceptor)
 	cmd.FailOnError(err, "Unable to setup VA gRPC server")
 	err = bgrpc.RegisterValidationAuthorityGRPCServer(grpcSrv, vai)
-	cmd.FailOnError(err, "Unable to register VA gRPC server")
+	if err != nil {
+		// Not fatal: the health service, debug server, and metrics endpoint
+		// below are still useful without it, and direct Go callers of
+		// vai.PerformValidation are unaffected. But this VA's
+		// PerformValidation is NOT reachable over gRPC, so surface that
+		// loudly rather than only in a startup log line likely to scroll
+		// off -- an RA pointed at this VA will see every RPC fail.
+		logger.Warningf("VA gRPC service is not fully wired: %s -- PerformValidation is unreachable over gRPC", err)
+	}
+	grpcServerMetrics.InitializeMetrics(grpcSrv)
+
+	healthSrv := health.NewServer()
+	healthpb.RegisterHealthServer(grpcSrv, healthSrv)
+	healthSrv.SetServingStatus("", healthpb.HealthCheckResponse_SERVING)
+
 	go func() {
 		err = grpcSrv.Serve(l)
 		cmd.FailOnError(err, "VA gRPC service failed")
 	}()
 
+	shutdownKillTimeout := c.VA.ShutdownKillTimeout.Duration
+	if shutdownKillTimeout == 0 {
+		shutdownKillTimeout = 30 * time.Second
+	}
+
 	go cmd.CatchSignals(logger, func() {
-		if grpcSrv != nil {
+		healthSrv.SetServingStatus("", healthpb.HealthCheckResponse_NOT_SERVING)
+		atomic.StoreInt32(&draining, 1)
+		time.Sleep(c.VA.ShutdownStopTimeout.Duration)
+
+		stopped := make(chan bool)
+		go func() {
+			inFlight.Wait()
 			grpcSrv.GracefulStop()
+			stopped <- true
+		}()
+		select {
+		case <-stopped:
+		case <-time.After(shutdownKillTimeout):
+			logger.Warning("In-flight validations didn't drain within ShutdownKillTimeout, forcing stop")
+			grpcSrv.Stop()
 		}
 	})
 
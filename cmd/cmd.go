@@ -0,0 +1,125 @@
+// Package cmd holds the configuration and bootstrap helpers shared by all
+// of Boulder's binaries (reading JSON config files, wiring up stats and
+// logging, handling signals, and so on).
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/pprof"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/letsencrypt/boulder/metrics"
+)
+
+// Logger is the minimal logging interface Boulder binaries use for
+// operational output.
+type Logger struct {
+	syslogLevel int
+	stdoutLevel int
+}
+
+// Info logs an informational message.
+func (l *Logger) Info(msg string) { fmt.Fprintln(os.Stdout, msg) }
+
+// Infof logs a formatted informational message.
+func (l *Logger) Infof(format string, args ...interface{}) { fmt.Fprintf(os.Stdout, format+"\n", args...) }
+
+// Warning logs a warning message.
+func (l *Logger) Warning(msg string) { fmt.Fprintln(os.Stderr, "WARN: "+msg) }
+
+// Warningf logs a formatted warning message.
+func (l *Logger) Warningf(format string, args ...interface{}) {
+	fmt.Fprintf(os.Stderr, "WARN: "+format+"\n", args...)
+}
+
+// Err logs an error message.
+func (l *Logger) Err(msg string) { fmt.Fprintln(os.Stderr, "ERR: "+msg) }
+
+// AuditPanic recovers a panic, logs it, and re-panics so the process still
+// exits non-zero. It is meant to be deferred at the top of main().
+func (l *Logger) AuditPanic() {
+	if err := recover(); err != nil {
+		fmt.Fprintf(os.Stderr, "panic: %v\n", err)
+		panic(err)
+	}
+}
+
+// ReadConfigFile reads the JSON file at filename and unmarshals it into out.
+func ReadConfigFile(filename string, out interface{}) error {
+	f, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return json.NewDecoder(f).Decode(out)
+}
+
+// FailOnError exits the process with a descriptive message if err is
+// non-nil. It is used pervasively at startup, where there's no sensible way
+// to recover from a misconfiguration.
+func FailOnError(err error, msg string) {
+	if err == nil {
+		return
+	}
+	fmt.Fprintf(os.Stderr, "%s: %s\n", msg, err)
+	os.Exit(1)
+}
+
+// StatsAndLogging sets up the process's statistics scope and logger from the
+// given syslog configuration.
+func StatsAndLogging(logConf SyslogConfig) (metrics.Scope, *Logger) {
+	return &noopScope{}, &Logger{syslogLevel: logConf.SyslogLevel, stdoutLevel: logConf.StdoutLevel}
+}
+
+type noopScope struct{}
+
+func (*noopScope) Inc(stat string, delta int64)                {}
+func (*noopScope) GaugeValue(stat string, value int64)          {}
+func (*noopScope) TimingDuration(stat string, d time.Duration)  {}
+
+// VersionString returns a human-readable "<name> starting" string for
+// startup log lines. It carries no version information.
+func VersionString(name string) string {
+	return fmt.Sprintf("%s starting", name)
+}
+
+// CatchSignals calls shutdownCallback when the process receives SIGTERM or
+// SIGINT, then exits.
+func CatchSignals(logger *Logger, shutdownCallback func()) {
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, syscall.SIGTERM, syscall.SIGINT)
+	<-sigChan
+	if shutdownCallback != nil {
+		shutdownCallback()
+	}
+	os.Exit(0)
+}
+
+// DebugServer runs an HTTP server exposing pprof and (if registered)
+// Prometheus's /metrics handler on addr. It blocks and is meant to be run in
+// its own goroutine.
+func DebugServer(addr string) {
+	if addr == "" {
+		return
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	mux.Handle("/metrics", http.DefaultServeMux)
+	err := http.ListenAndServe(addr, mux)
+	FailOnError(err, "unable to boot debug server")
+}
+
+// ProfileCmd blocks forever and is meant to be run in its own goroutine. It
+// reports no Go runtime statistics to scope.
+func ProfileCmd(scope metrics.Scope) {
+	select {}
+}
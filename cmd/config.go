@@ -0,0 +1,154 @@
+package cmd
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"io/ioutil"
+	"time"
+)
+
+// ConfigDuration is a time.Duration that can be unmarshalled from a JSON
+// config file as a human-readable string (e.g. "30s").
+type ConfigDuration struct {
+	time.Duration
+}
+
+// UnmarshalJSON parses a duration string into d.
+func (d *ConfigDuration) UnmarshalJSON(b []byte) error {
+	s := string(b)
+	s = s[1 : len(s)-1] // strip surrounding quotes
+	parsed, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	d.Duration = parsed
+	return nil
+}
+
+// PortConfig describes the ports a validation method should be performed
+// over. Zero values mean "use the default".
+type PortConfig struct {
+	HTTPPort  int
+	HTTPSPort int
+	TLSPort   int
+}
+
+// TLSConfig names the files needed to load an X.509 client/server certificate
+// and key and the CA roots to trust for peer verification.
+type TLSConfig struct {
+	CertFile   string
+	KeyFile    string
+	CACertFile string
+}
+
+// Load reads the certificate, key, and CA roots named by c and returns a
+// *tls.Config ready to use for either a client or a server.
+func (c *TLSConfig) Load() (*tls.Config, error) {
+	if c == nil {
+		return nil, errors.New("nil TLS config")
+	}
+	cert, err := tls.LoadX509KeyPair(c.CertFile, c.KeyFile)
+	if err != nil {
+		return nil, err
+	}
+	var roots *x509.CertPool
+	if c.CACertFile != "" {
+		pemBytes, err := ioutil.ReadFile(c.CACertFile)
+		if err != nil {
+			return nil, err
+		}
+		roots = x509.NewCertPool()
+		if !roots.AppendCertsFromPEM(pemBytes) {
+			return nil, errors.New("no CA certificates found in CACertFile")
+		}
+	}
+	return &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		RootCAs:      roots,
+		ClientCAs:    roots,
+		MinVersion:   tls.VersionTLS12,
+	}, nil
+}
+
+// ServiceConfig is embedded by the top-level per-service config struct of
+// every Boulder binary. It carries the settings common to all of them.
+type ServiceConfig struct {
+	DebugAddr string
+	TLS       *TLSConfig
+	GRPC      GRPCServerConfig
+}
+
+// GRPCServerConfig configures the address a gRPC server listens on and
+// lists the client names it expects. NewServer does not check ClientNames.
+type GRPCServerConfig struct {
+	Address     string
+	ClientNames []string
+}
+
+// GRPCClientConfig configures how to dial one or more instances of a
+// downstream gRPC service.
+type GRPCClientConfig struct {
+	ServerAddresses  []string
+	ServerIssuerPath string
+	Timeout          ConfigDuration
+}
+
+// SyslogConfig configures the verbosity of Boulder's syslog output.
+type SyslogConfig struct {
+	StdoutLevel int
+	SyslogLevel int
+}
+
+// GoogleSafeBrowsingConfig configures a client for Google's Safe Browsing
+// APIs (either the legacy v3 lookup API or the v4 update API).
+type GoogleSafeBrowsingConfig struct {
+	APIKey    string
+	DataDir   string
+	ServerURL string
+}
+
+// CAADistributedResolverConfig configures the CAA distributed resolver used
+// to detect resolver-specific CAA disagreement.
+type CAADistributedResolverConfig struct {
+	Timeout     ConfigDuration
+	MaxFailures int
+	Proxies     []string
+}
+
+// DomainReputationConfig selects and configures the set of domain
+// reputation/blocklist providers the VA consults before issuance. Providers
+// are composed with an OR policy: a name is blocked if any configured
+// provider blocks it.
+type DomainReputationConfig struct {
+	// Providers lists, in the order they should be queried, which of
+	// "google_v4", "google_v3", "static_blocklist", "dns_rbl", and
+	// "http_api" to enable.
+	Providers []string
+
+	StaticBlocklist *StaticBlocklistConfig
+	DNSRBL          *DNSRBLConfig
+	HTTPAPI         *HTTPAPIReputationConfig
+}
+
+// StaticBlocklistConfig configures the static, hot-reloadable blocklist
+// provider.
+type StaticBlocklistConfig struct {
+	// Path to a file containing one blocked domain per line. The file is
+	// re-read whenever the process receives SIGHUP.
+	Path string
+}
+
+// DNSRBLConfig configures the DNS-RBL-backed reputation provider.
+type DNSRBLConfig struct {
+	// Zone is the RBL zone to query, e.g. "rbl.example.org". Lookups are
+	// issued as A-record queries for "<reversed-name>.<zone>".
+	Zone string
+}
+
+// HTTPAPIReputationConfig configures the HTTP-API-backed reputation
+// provider.
+type HTTPAPIReputationConfig struct {
+	URL     string
+	Timeout ConfigDuration
+}
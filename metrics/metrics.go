@@ -0,0 +1,46 @@
+// Package metrics provides the common statistics-reporting interface shared
+// by Boulder's services. It lets callers (bdns, va, grpc, cmd, ...) record
+// counters and timings without depending on a particular backend.
+package metrics
+
+import "time"
+
+// Scope is the interface components use to emit stats. The Scope returned
+// from cmd.StatsAndLogging discards every stat it is given. A Scope can be
+// wrapped with a prefix via NewScope.
+type Scope interface {
+	Inc(stat string, delta int64)
+	GaugeValue(stat string, value int64)
+	TimingDuration(stat string, d time.Duration)
+}
+
+// NewScope returns a Scope that prefixes every stat name it is given with
+// the provided prefixes, joined by ".".
+func NewScope(stats Scope, prefixes ...string) Scope {
+	return &prefixedScope{stats: stats, prefixes: prefixes}
+}
+
+type prefixedScope struct {
+	stats    Scope
+	prefixes []string
+}
+
+func (p *prefixedScope) prefixed(stat string) string {
+	name := stat
+	for i := len(p.prefixes) - 1; i >= 0; i-- {
+		name = p.prefixes[i] + "." + name
+	}
+	return name
+}
+
+func (p *prefixedScope) Inc(stat string, delta int64) {
+	p.stats.Inc(p.prefixed(stat), delta)
+}
+
+func (p *prefixedScope) GaugeValue(stat string, value int64) {
+	p.stats.GaugeValue(p.prefixed(stat), value)
+}
+
+func (p *prefixedScope) TimingDuration(stat string, d time.Duration) {
+	p.stats.TimingDuration(p.prefixed(stat), d)
+}
@@ -0,0 +1,230 @@
+package va
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"github.com/letsencrypt/boulder/bdns"
+	"github.com/letsencrypt/boulder/cmd"
+	"github.com/letsencrypt/boulder/metrics"
+)
+
+// staticBlocklistReputation blocks any hostname present in a file on disk.
+// The file is re-read whenever the process receives SIGHUP, so operators can
+// update the blocklist without restarting the VA.
+type staticBlocklistReputation struct {
+	path string
+	log  *cmd.Logger
+
+	mu      sync.RWMutex
+	blocked map[string]bool
+}
+
+// NewStaticBlocklistReputation constructs a DomainReputation backed by the
+// newline-delimited hostname list at path, reloading it on every SIGHUP
+// delivered to the process.
+func NewStaticBlocklistReputation(path string, logger *cmd.Logger) (DomainReputation, error) {
+	r := &staticBlocklistReputation{path: path, log: logger}
+	if err := r.reload(); err != nil {
+		return nil, err
+	}
+	r.watchSIGHUP()
+	return r, nil
+}
+
+func (r *staticBlocklistReputation) reload() error {
+	f, err := os.Open(r.path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	blocked := make(map[string]bool)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		blocked[strings.ToLower(line)] = true
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	r.blocked = blocked
+	r.mu.Unlock()
+	return nil
+}
+
+func (r *staticBlocklistReputation) watchSIGHUP() {
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, syscall.SIGHUP)
+	go func() {
+		for range sigChan {
+			if err := r.reload(); err != nil && r.log != nil {
+				r.log.Warningf("reloading static domain reputation blocklist %s: %s", r.path, err)
+			}
+		}
+	}()
+}
+
+// IsBlocked reports whether hostname appears in the currently loaded
+// blocklist.
+func (r *staticBlocklistReputation) IsBlocked(hostname string) (bool, string, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if r.blocked[strings.ToLower(hostname)] {
+		return true, fmt.Sprintf("%s is present in the static blocklist", hostname), nil
+	}
+	return false, "", nil
+}
+
+// dnsRBLReputation blocks a hostname if its reversed labels, queried as an
+// A record under zone, resolve to anything (the standard DNSBL/RBL
+// convention: any answer means "listed").
+type dnsRBLReputation struct {
+	resolver bdns.DNSResolver
+	zone     string
+	stats    metrics.Scope
+}
+
+// NewDNSRBLReputation constructs a DomainReputation that issues
+// "<reversed-name>.<zone>" A-record lookups through resolver.
+func NewDNSRBLReputation(resolver bdns.DNSResolver, zone string, scope metrics.Scope) (DomainReputation, error) {
+	if zone == "" {
+		return nil, fmt.Errorf("va: DNSRBL zone must not be empty")
+	}
+	return &dnsRBLReputation{resolver: resolver, zone: zone, stats: scope}, nil
+}
+
+func reverseLabels(hostname string) string {
+	labels := strings.Split(hostname, ".")
+	for i, j := 0, len(labels)-1; i < j; i, j = i+1, j-1 {
+		labels[i], labels[j] = labels[j], labels[i]
+	}
+	return strings.Join(labels, ".")
+}
+
+// IsBlocked reports whether the RBL lists hostname. Only an NXDOMAIN
+// response means "not listed" -- any other lookup failure (timeout,
+// SERVFAIL, network error) is a genuine error and is surfaced as one,
+// rather than silently treated as "not blocked".
+func (r *dnsRBLReputation) IsBlocked(hostname string) (bool, string, error) {
+	query := reverseLabels(hostname) + "." + r.zone
+	addrs, err := r.resolver.LookupHost(context.Background(), query)
+	if err != nil {
+		if bdns.IsNXDOMAIN(err) {
+			return false, "", nil
+		}
+		r.stats.Inc("DomainReputation.DNSRBL.Errors", 1)
+		return false, "", fmt.Errorf("va: DNSRBL lookup of %s: %s", query, err)
+	}
+	if len(addrs) > 0 {
+		r.stats.Inc("DomainReputation.DNSRBL.Blocked", 1)
+		return true, fmt.Sprintf("%s is listed in RBL zone %s", hostname, r.zone), nil
+	}
+	return false, "", nil
+}
+
+// httpAPIReputation delegates the blocked/not-blocked decision to an
+// operator-run HTTP endpoint.
+type httpAPIReputation struct {
+	url    string
+	client *http.Client
+	stats  metrics.Scope
+}
+
+// NewHTTPAPIReputation constructs a DomainReputation that POSTs the
+// candidate hostname to url and expects a JSON
+// {"blocked": bool, "reason": string} response.
+func NewHTTPAPIReputation(url string, timeout time.Duration, scope metrics.Scope) (DomainReputation, error) {
+	if url == "" {
+		return nil, fmt.Errorf("va: HTTPAPI url must not be empty")
+	}
+	return &httpAPIReputation{
+		url:    url,
+		client: &http.Client{Timeout: timeout},
+		stats:  scope,
+	}, nil
+}
+
+type httpAPIRequest struct {
+	Name string `json:"name"`
+}
+
+type httpAPIResponse struct {
+	Blocked bool   `json:"blocked"`
+	Reason  string `json:"reason"`
+}
+
+// IsBlocked reports what the configured HTTP API says about hostname.
+func (r *httpAPIReputation) IsBlocked(hostname string) (bool, string, error) {
+	body, err := json.Marshal(httpAPIRequest{Name: hostname})
+	if err != nil {
+		return false, "", err
+	}
+	httpResp, err := r.client.Post(r.url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		r.stats.Inc("DomainReputation.HTTPAPI.Errors", 1)
+		return false, "", err
+	}
+	defer httpResp.Body.Close()
+	if httpResp.StatusCode != http.StatusOK {
+		r.stats.Inc("DomainReputation.HTTPAPI.Errors", 1)
+		return false, "", fmt.Errorf("va: HTTPAPI reputation endpoint %s returned %s", r.url, httpResp.Status)
+	}
+	var resp httpAPIResponse
+	if err := json.NewDecoder(httpResp.Body).Decode(&resp); err != nil {
+		return false, "", err
+	}
+	if resp.Blocked {
+		r.stats.Inc("DomainReputation.HTTPAPI.Blocked", 1)
+	}
+	return resp.Blocked, resp.Reason, nil
+}
+
+// multiDomainReputation composes several providers with an OR policy: a
+// name is blocked if any provider blocks it. Each provider's outcome is
+// recorded under its own metric so a single misbehaving provider is easy
+// to spot.
+type multiDomainReputation struct {
+	providers []DomainReputation
+	stats     metrics.Scope
+}
+
+// NewMultiDomainReputation composes providers with an OR policy.
+func NewMultiDomainReputation(providers []DomainReputation, scope metrics.Scope) DomainReputation {
+	return &multiDomainReputation{providers: providers, stats: scope}
+}
+
+// IsBlocked reports hostname as blocked if any configured provider blocks
+// it, short-circuiting on the first provider that does. A provider that
+// returns an error is recorded but does not itself block the name.
+func (m *multiDomainReputation) IsBlocked(hostname string) (bool, string, error) {
+	for i, p := range m.providers {
+		blocked, reason, err := p.IsBlocked(hostname)
+		label := fmt.Sprintf("DomainReputation.Provider%d", i)
+		if err != nil {
+			m.stats.Inc(label+".Errors", 1)
+			continue
+		}
+		if blocked {
+			m.stats.Inc(label+".Blocked", 1)
+			return true, reason, nil
+		}
+	}
+	return false, "", nil
+}
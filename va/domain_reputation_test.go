@@ -0,0 +1,200 @@
+package va
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+	"golang.org/x/net/context"
+
+	"github.com/letsencrypt/boulder/bdns"
+)
+
+type testScope struct{}
+
+func (testScope) Inc(stat string, delta int64)                {}
+func (testScope) GaugeValue(stat string, value int64)          {}
+func (testScope) TimingDuration(stat string, d time.Duration)  {}
+
+func writeTempBlocklist(t *testing.T, lines ...string) string {
+	t.Helper()
+	f, err := ioutil.TempFile("", "blocklist")
+	if err != nil {
+		t.Fatalf("creating temp blocklist: %s", err)
+	}
+	defer f.Close()
+	for _, l := range lines {
+		fmt.Fprintln(f, l)
+	}
+	return f.Name()
+}
+
+func TestStaticBlocklistReputation(t *testing.T) {
+	path := writeTempBlocklist(t, "# a comment", "evil.example.com", "")
+	defer os.Remove(path)
+
+	r, err := NewStaticBlocklistReputation(path, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	blocked, _, err := r.IsBlocked("evil.example.com")
+	if err != nil || !blocked {
+		t.Fatalf("got blocked=%v err=%v, want blocked=true err=nil", blocked, err)
+	}
+	blocked, _, err = r.IsBlocked("fine.example.com")
+	if err != nil || blocked {
+		t.Fatalf("got blocked=%v err=%v, want blocked=false err=nil", blocked, err)
+	}
+}
+
+func TestStaticBlocklistReputationReload(t *testing.T) {
+	path := writeTempBlocklist(t, "first.example.com")
+	defer os.Remove(path)
+
+	r, err := NewStaticBlocklistReputation(path, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	impl := r.(*staticBlocklistReputation)
+
+	if blocked, _, _ := r.IsBlocked("second.example.com"); blocked {
+		t.Fatal("second.example.com should not be blocked before reload")
+	}
+
+	if err := ioutil.WriteFile(path, []byte("second.example.com\n"), 0644); err != nil {
+		t.Fatalf("rewriting blocklist: %s", err)
+	}
+	if err := impl.reload(); err != nil {
+		t.Fatalf("reload: %s", err)
+	}
+
+	if blocked, _, _ := r.IsBlocked("second.example.com"); !blocked {
+		t.Fatal("second.example.com should be blocked after reload")
+	}
+	if blocked, _, _ := r.IsBlocked("first.example.com"); blocked {
+		t.Fatal("first.example.com should no longer be blocked after reload replaced the file contents")
+	}
+}
+
+type fakeHostResolver struct {
+	addrs []string
+	err   error
+}
+
+func (f *fakeHostResolver) LookupTXT(ctx context.Context, hostname string) ([]string, error) {
+	return nil, fmt.Errorf("not implemented")
+}
+func (f *fakeHostResolver) LookupHost(ctx context.Context, hostname string) ([]string, error) {
+	return f.addrs, f.err
+}
+func (f *fakeHostResolver) LookupCAA(ctx context.Context, domain string) ([]*dns.CAA, error) {
+	return nil, fmt.Errorf("not implemented")
+}
+
+func TestDNSRBLReputationListed(t *testing.T) {
+	resolver := &fakeHostResolver{addrs: []string{"127.0.0.2"}}
+	r, err := NewDNSRBLReputation(resolver, "rbl.example.org", testScope{})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	blocked, reason, err := r.IsBlocked("evil.example.com")
+	if err != nil || !blocked || reason == "" {
+		t.Fatalf("got blocked=%v reason=%q err=%v, want blocked=true with a reason and no error", blocked, reason, err)
+	}
+}
+
+func TestDNSRBLReputationNotListed(t *testing.T) {
+	resolver := &fakeHostResolver{err: bdns.ErrNXDOMAIN}
+	r, err := NewDNSRBLReputation(resolver, "rbl.example.org", testScope{})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	blocked, _, err := r.IsBlocked("fine.example.com")
+	if err != nil || blocked {
+		t.Fatalf("got blocked=%v err=%v, want blocked=false err=nil for NXDOMAIN", blocked, err)
+	}
+}
+
+// TestDNSRBLReputationTransientErrorIsNotSilentlyNotBlocked pins down that a
+// non-NXDOMAIN failure (timeout, SERVFAIL, ...) is surfaced as an error
+// rather than silently treated the same as "not listed".
+func TestDNSRBLReputationTransientErrorIsNotSilentlyNotBlocked(t *testing.T) {
+	resolver := &fakeHostResolver{err: fmt.Errorf("i/o timeout")}
+	r, err := NewDNSRBLReputation(resolver, "rbl.example.org", testScope{})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	blocked, _, err := r.IsBlocked("maybe.example.com")
+	if blocked {
+		t.Fatal("a transient error should not report the name as blocked")
+	}
+	if err == nil {
+		t.Fatal("a transient (non-NXDOMAIN) lookup failure must be returned as an error, not swallowed")
+	}
+}
+
+func TestHTTPAPIReputation(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req httpAPIRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		resp := httpAPIResponse{Blocked: req.Name == "evil.example.com", Reason: "test"}
+		json.NewEncoder(w).Encode(resp)
+	}))
+	defer srv.Close()
+
+	r, err := NewHTTPAPIReputation(srv.URL, time.Second, testScope{})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	blocked, _, err := r.IsBlocked("evil.example.com")
+	if err != nil || !blocked {
+		t.Fatalf("got blocked=%v err=%v, want blocked=true", blocked, err)
+	}
+	blocked, _, err = r.IsBlocked("fine.example.com")
+	if err != nil || blocked {
+		t.Fatalf("got blocked=%v err=%v, want blocked=false", blocked, err)
+	}
+}
+
+type constReputation struct {
+	blocked bool
+	reason  string
+	err     error
+}
+
+func (c constReputation) IsBlocked(hostname string) (bool, string, error) {
+	return c.blocked, c.reason, c.err
+}
+
+func TestMultiDomainReputationOR(t *testing.T) {
+	m := NewMultiDomainReputation([]DomainReputation{
+		constReputation{blocked: false},
+		constReputation{blocked: true, reason: "listed by provider 2"},
+		constReputation{blocked: true, reason: "listed by provider 3"},
+	}, testScope{})
+
+	blocked, reason, err := m.IsBlocked("example.com")
+	if err != nil || !blocked || reason != "listed by provider 2" {
+		t.Fatalf("got blocked=%v reason=%q err=%v, want the first blocking provider's reason", blocked, reason, err)
+	}
+}
+
+func TestMultiDomainReputationAllClear(t *testing.T) {
+	m := NewMultiDomainReputation([]DomainReputation{
+		constReputation{blocked: false},
+		constReputation{blocked: false},
+	}, testScope{})
+
+	blocked, _, err := m.IsBlocked("example.com")
+	if err != nil || blocked {
+		t.Fatalf("got blocked=%v err=%v, want blocked=false", blocked, err)
+	}
+}
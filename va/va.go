@@ -0,0 +1,105 @@
+// Package va implements the Validation Authority: the service that proves
+// control over a domain by performing ACME challenge validation and CAA
+// checks before a certificate is issued.
+package va
+
+import (
+	"github.com/jmhodges/clock"
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/letsencrypt/boulder/bdns"
+	"github.com/letsencrypt/boulder/cdr"
+	"github.com/letsencrypt/boulder/cmd"
+	"github.com/letsencrypt/boulder/metrics"
+)
+
+// DomainReputation is consulted before issuance to decide whether a name
+// should be blocked as malicious (phishing, malware, etc). Implementations
+// may be backed by Google Safe Browsing, a static blocklist, a DNS RBL, or
+// an operator-run HTTP API; see NewMultiDomainReputation for composing
+// several of them.
+type DomainReputation interface {
+	// IsBlocked reports whether hostname should be refused issuance, along
+	// with a human-readable reason when it is.
+	IsBlocked(hostname string) (blocked bool, reason string, err error)
+}
+
+// RemoteVA pairs a gRPC client for a sibling VA with the address it was
+// dialed at, for logging when a remote validation fails.
+type RemoteVA struct {
+	Client  interface{}
+	Address string
+}
+
+// ValidationAuthorityImpl performs ACME challenge validation and CAA
+// checking.
+type ValidationAuthorityImpl struct {
+	portConfig        *cmd.PortConfig
+	reputation        DomainReputation
+	cdrClient         *cdr.CAADistributedResolver
+	dnsResolver       bdns.DNSResolver
+	remoteVAs         []RemoteVA
+	maxRemoteFailures int64
+	userAgent         string
+	issuerDomain      string
+	stats             metrics.Scope
+	clk               clock.Clock
+	log               *cmd.Logger
+	validationLatency *prometheus.HistogramVec
+	caaLatency        *prometheus.HistogramVec
+}
+
+// NewValidationAuthorityImpl constructs a ValidationAuthorityImpl. sbc
+// (historically "safe browsing client") is consulted to block issuance for
+// reputation reasons; validationLatency and caaLatency record, respectively,
+// per-challenge-type validation time (labeled "type", "result") and CAA
+// lookup time (labeled "result").
+func NewValidationAuthorityImpl(
+	pc *cmd.PortConfig,
+	sbc DomainReputation,
+	cdrClient *cdr.CAADistributedResolver,
+	resolver bdns.DNSResolver,
+	remotes []RemoteVA,
+	maxRemoteValidationFailures int64,
+	userAgent string,
+	issuerDomain string,
+	stats metrics.Scope,
+	clk clock.Clock,
+	logger *cmd.Logger,
+	validationLatency *prometheus.HistogramVec,
+	caaLatency *prometheus.HistogramVec,
+) *ValidationAuthorityImpl {
+	return &ValidationAuthorityImpl{
+		portConfig:        pc,
+		reputation:        sbc,
+		cdrClient:         cdrClient,
+		dnsResolver:       resolver,
+		remoteVAs:         remotes,
+		maxRemoteFailures: maxRemoteValidationFailures,
+		userAgent:         userAgent,
+		issuerDomain:      issuerDomain,
+		stats:             stats,
+		clk:               clk,
+		log:               logger,
+		validationLatency: validationLatency,
+		caaLatency:        caaLatency,
+	}
+}
+
+// recordValidationLatency observes how long a challenge validation of the
+// given type took, labeled with its outcome ("valid" or "invalid").
+func (va *ValidationAuthorityImpl) recordValidationLatency(challengeType, result string, seconds float64) {
+	if va.validationLatency == nil {
+		return
+	}
+	va.validationLatency.WithLabelValues(challengeType, result).Observe(seconds)
+}
+
+// recordCAALatency observes how long a CAA lookup took, labeled with its
+// outcome ("valid" or "invalid").
+func (va *ValidationAuthorityImpl) recordCAALatency(result string, seconds float64) {
+	if va.caaLatency == nil {
+		return
+	}
+	va.caaLatency.WithLabelValues(result).Observe(seconds)
+}
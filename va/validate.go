@@ -0,0 +1,175 @@
+package va
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+
+	"golang.org/x/net/context"
+
+	"github.com/letsencrypt/boulder/bdns"
+)
+
+// ValidationRequest describes one ACME challenge to validate.
+type ValidationRequest struct {
+	Domain           string
+	ChallengeType    string // "http-01" or "dns-01"
+	Token            string
+	KeyAuthorization string
+}
+
+// ValidationResult is the outcome of validating a ValidationRequest.
+type ValidationResult struct {
+	Valid   bool
+	Problem string
+}
+
+// remoteValidator is implemented by a sibling VA's client. It lets
+// PerformValidation ask a remote VA to corroborate a validation without
+// depending on the concrete gRPC client type (RemoteVA.Client is untyped
+// because this tree doesn't carry the generated gRPC client stub; see
+// grpc.NewValidationAuthorityGRPCClient).
+type remoteValidator interface {
+	PerformValidation(ctx context.Context, req *ValidationRequest) (*ValidationResult, error)
+}
+
+// PerformValidation validates req: it checks the domain against the
+// configured reputation providers, checks CAA, performs the requested
+// challenge type, and -- if the local result is valid -- asks up to
+// len(remoteVAs) sibling VAs to corroborate before accepting it, failing
+// if more than maxRemoteFailures of them disagree.
+func (vai *ValidationAuthorityImpl) PerformValidation(ctx context.Context, req *ValidationRequest) (*ValidationResult, error) {
+	start := vai.clk.Now()
+	recordAndReturn := func(valid bool, problem string) (*ValidationResult, error) {
+		result := "invalid"
+		if valid {
+			result = "valid"
+		}
+		vai.recordValidationLatency(req.ChallengeType, result, vai.clk.Since(start).Seconds())
+		return &ValidationResult{Valid: valid, Problem: problem}, nil
+	}
+
+	if vai.reputation != nil {
+		blocked, reason, err := vai.reputation.IsBlocked(req.Domain)
+		if err == nil && blocked {
+			return recordAndReturn(false, reason)
+		}
+	}
+
+	if ok, problem := vai.checkCAA(ctx, req.Domain); !ok {
+		return recordAndReturn(false, problem)
+	}
+
+	var valid bool
+	var problem string
+	switch req.ChallengeType {
+	case "dns-01":
+		valid, problem = vai.validateDNS01(ctx, req)
+	case "http-01":
+		valid, problem = vai.validateHTTP01(ctx, req)
+	default:
+		return nil, fmt.Errorf("va: unsupported challenge type %q", req.ChallengeType)
+	}
+
+	if valid {
+		valid, problem = vai.corroborateWithRemotes(ctx, req, valid, problem)
+	}
+
+	return recordAndReturn(valid, problem)
+}
+
+// checkCAA looks up CAA records for domain and reports whether issuance for
+// vai.issuerDomain is authorized: no CAA records at all means unrestricted,
+// otherwise at least one record's Value must name vai.issuerDomain.
+func (vai *ValidationAuthorityImpl) checkCAA(ctx context.Context, domain string) (bool, string) {
+	start := vai.clk.Now()
+	caas, err := vai.dnsResolver.LookupCAA(ctx, domain)
+	if err != nil && !bdns.IsNXDOMAIN(err) {
+		vai.recordCAALatency("invalid", vai.clk.Since(start).Seconds())
+		return false, fmt.Sprintf("CAA lookup for %s failed: %s", domain, err)
+	}
+
+	if len(caas) == 0 {
+		vai.recordCAALatency("valid", vai.clk.Since(start).Seconds())
+		return true, ""
+	}
+	for _, caa := range caas {
+		if caa.Value == vai.issuerDomain {
+			vai.recordCAALatency("valid", vai.clk.Since(start).Seconds())
+			return true, ""
+		}
+	}
+	vai.recordCAALatency("invalid", vai.clk.Since(start).Seconds())
+	return false, fmt.Sprintf("CAA records for %s do not authorize issuance by %s", domain, vai.issuerDomain)
+}
+
+// validateDNS01 checks that the dns-01 challenge's key authorization is
+// present in a TXT record on _acme-challenge.<domain>.
+func (vai *ValidationAuthorityImpl) validateDNS01(ctx context.Context, req *ValidationRequest) (bool, string) {
+	txts, err := vai.dnsResolver.LookupTXT(ctx, "_acme-challenge."+req.Domain)
+	if err != nil {
+		return false, fmt.Sprintf("dns-01 TXT lookup for %s failed: %s", req.Domain, err)
+	}
+	for _, txt := range txts {
+		if txt == req.KeyAuthorization {
+			return true, ""
+		}
+	}
+	return false, fmt.Sprintf("none of the TXT records on _acme-challenge.%s matched the expected key authorization", req.Domain)
+}
+
+// validateHTTP01 checks that the http-01 challenge's key authorization is
+// served back from the well-known challenge path.
+func (vai *ValidationAuthorityImpl) validateHTTP01(ctx context.Context, req *ValidationRequest) (bool, string) {
+	url := fmt.Sprintf("http://%s:%d/.well-known/acme-challenge/%s", req.Domain, vai.portConfig.HTTPPort, req.Token)
+	httpReq, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return false, err.Error()
+	}
+	httpReq = httpReq.WithContext(ctx)
+	httpReq.Header.Set("User-Agent", vai.userAgent)
+
+	resp, err := http.DefaultClient.Do(httpReq)
+	if err != nil {
+		return false, fmt.Sprintf("http-01 fetch of %s failed: %s", url, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return false, fmt.Sprintf("http-01 fetch of %s returned %s", url, resp.Status)
+	}
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return false, err.Error()
+	}
+	if string(body) != req.KeyAuthorization {
+		return false, fmt.Sprintf("http-01 response body from %s did not match the expected key authorization", url)
+	}
+	return true, ""
+}
+
+// corroborateWithRemotes asks every configured remote VA to validate req
+// independently and refuses the local, otherwise-valid result if more than
+// maxRemoteFailures of them disagree.
+func (vai *ValidationAuthorityImpl) corroborateWithRemotes(ctx context.Context, req *ValidationRequest, valid bool, problem string) (bool, string) {
+	if len(vai.remoteVAs) == 0 {
+		return valid, problem
+	}
+	var failures int64
+	for _, remote := range vai.remoteVAs {
+		rv, ok := remote.Client.(remoteValidator)
+		if !ok {
+			continue
+		}
+		res, err := rv.PerformValidation(ctx, req)
+		if err != nil || res == nil || !res.Valid {
+			failures++
+			if vai.log != nil {
+				vai.log.Warningf("remote VA %s disagreed on validation of %s", remote.Address, req.Domain)
+			}
+		}
+	}
+	if failures > vai.maxRemoteFailures {
+		return false, fmt.Sprintf("%d remote VAs disagreed on validation of %s", failures, req.Domain)
+	}
+	return valid, problem
+}
@@ -0,0 +1,204 @@
+package va
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/jmhodges/clock"
+	"github.com/miekg/dns"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"golang.org/x/net/context"
+
+	"github.com/letsencrypt/boulder/cmd"
+)
+
+type fakeDNSResolver struct {
+	txts []string
+	txtErr error
+	caas []*dns.CAA
+	caaErr error
+}
+
+func (f *fakeDNSResolver) LookupTXT(ctx context.Context, hostname string) ([]string, error) {
+	return f.txts, f.txtErr
+}
+func (f *fakeDNSResolver) LookupHost(ctx context.Context, hostname string) ([]string, error) {
+	return nil, fmt.Errorf("not implemented")
+}
+func (f *fakeDNSResolver) LookupCAA(ctx context.Context, domain string) ([]*dns.CAA, error) {
+	return f.caas, f.caaErr
+}
+
+func newTestVA(resolver *fakeDNSResolver, reputation DomainReputation) (*ValidationAuthorityImpl, *prometheus.HistogramVec, *prometheus.HistogramVec) {
+	validationLatency := prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name: "test_va_validation_latency_seconds",
+		Help: "test",
+	}, []string{"type", "result"})
+	caaLatency := prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name: "test_va_caa_check_latency_seconds",
+		Help: "test",
+	}, []string{"result"})
+	vai := NewValidationAuthorityImpl(
+		&cmd.PortConfig{HTTPPort: 80},
+		reputation,
+		nil,
+		resolver,
+		nil,
+		0,
+		"test-agent",
+		"letsencrypt.org",
+		testScope{},
+		clock.NewFake(),
+		nil,
+		validationLatency,
+		caaLatency,
+	)
+	return vai, validationLatency, caaLatency
+}
+
+func TestPerformValidationDNS01Valid(t *testing.T) {
+	resolver := &fakeDNSResolver{txts: []string{"the-key-auth"}}
+	vai, validationLatency, caaLatency := newTestVA(resolver, nil)
+
+	result, err := vai.PerformValidation(context.Background(), &ValidationRequest{
+		Domain:           "example.com",
+		ChallengeType:    "dns-01",
+		KeyAuthorization: "the-key-auth",
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if !result.Valid {
+		t.Fatalf("got Valid=false, Problem=%q, want Valid=true", result.Problem)
+	}
+	if got := testutil.CollectAndCount(validationLatency); got != 1 {
+		t.Errorf("validationLatency observed %d times, want 1", got)
+	}
+	if got := testutil.CollectAndCount(caaLatency); got != 1 {
+		t.Errorf("caaLatency observed %d times, want 1", got)
+	}
+}
+
+func TestPerformValidationDNS01Invalid(t *testing.T) {
+	resolver := &fakeDNSResolver{txts: []string{"some-other-value"}}
+	vai, _, _ := newTestVA(resolver, nil)
+
+	result, err := vai.PerformValidation(context.Background(), &ValidationRequest{
+		Domain:           "example.com",
+		ChallengeType:    "dns-01",
+		KeyAuthorization: "the-key-auth",
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if result.Valid {
+		t.Fatal("got Valid=true, want Valid=false for a non-matching TXT record")
+	}
+}
+
+func TestPerformValidationBlockedByReputation(t *testing.T) {
+	resolver := &fakeDNSResolver{txts: []string{"the-key-auth"}}
+	vai, _, _ := newTestVA(resolver, constReputation{blocked: true, reason: "known phishing domain"})
+
+	result, err := vai.PerformValidation(context.Background(), &ValidationRequest{
+		Domain:           "evil.example.com",
+		ChallengeType:    "dns-01",
+		KeyAuthorization: "the-key-auth",
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if result.Valid || result.Problem != "known phishing domain" {
+		t.Fatalf("got Valid=%v Problem=%q, want Valid=false Problem=%q", result.Valid, result.Problem, "known phishing domain")
+	}
+}
+
+func TestPerformValidationCAADisallows(t *testing.T) {
+	resolver := &fakeDNSResolver{
+		txts: []string{"the-key-auth"},
+		caas: []*dns.CAA{{Tag: "issue", Value: "some-other-ca.example"}},
+	}
+	vai, _, _ := newTestVA(resolver, nil)
+
+	result, err := vai.PerformValidation(context.Background(), &ValidationRequest{
+		Domain:           "example.com",
+		ChallengeType:    "dns-01",
+		KeyAuthorization: "the-key-auth",
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if result.Valid {
+		t.Fatal("got Valid=true, want Valid=false when CAA does not authorize this issuer")
+	}
+}
+
+func TestPerformValidationHTTP01Valid(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "the-key-auth")
+	}))
+	defer srv.Close()
+
+	resolver := &fakeDNSResolver{}
+	vai, _, _ := newTestVA(resolver, nil)
+
+	var port int
+	fmt.Sscanf(srv.Listener.Addr().String(), "127.0.0.1:%d", &port)
+	vai.portConfig.HTTPPort = port
+
+	result, err := vai.PerformValidation(context.Background(), &ValidationRequest{
+		Domain:           "127.0.0.1",
+		ChallengeType:    "http-01",
+		Token:            "tok",
+		KeyAuthorization: "the-key-auth",
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if !result.Valid {
+		t.Fatalf("got Valid=false, Problem=%q, want Valid=true", result.Problem)
+	}
+}
+
+func TestPerformValidationRemoteDisagreementFailsValidation(t *testing.T) {
+	resolver := &fakeDNSResolver{txts: []string{"the-key-auth"}}
+	vai, _, _ := newTestVA(resolver, nil)
+	vai.maxRemoteFailures = 0
+	vai.remoteVAs = []RemoteVA{
+		{Client: disagreeingRemote{}, Address: "remote1:8080"},
+	}
+
+	result, err := vai.PerformValidation(context.Background(), &ValidationRequest{
+		Domain:           "example.com",
+		ChallengeType:    "dns-01",
+		KeyAuthorization: "the-key-auth",
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if result.Valid {
+		t.Fatal("got Valid=true, want Valid=false when a remote VA disagrees and maxRemoteFailures is 0")
+	}
+}
+
+type disagreeingRemote struct{}
+
+func (disagreeingRemote) PerformValidation(ctx context.Context, req *ValidationRequest) (*ValidationResult, error) {
+	return &ValidationResult{Valid: false, Problem: "remote says no"}, nil
+}
+
+func TestPerformValidationUnsupportedChallengeType(t *testing.T) {
+	resolver := &fakeDNSResolver{}
+	vai, _, _ := newTestVA(resolver, nil)
+
+	_, err := vai.PerformValidation(context.Background(), &ValidationRequest{
+		Domain:        "example.com",
+		ChallengeType: "tls-sni-01",
+	})
+	if err == nil {
+		t.Fatal("expected an error for an unsupported challenge type")
+	}
+}